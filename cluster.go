@@ -0,0 +1,62 @@
+package red
+
+import (
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// WithRedisCluster runs the queue against a Redis Cluster deployment. All
+// keys for a given queue are wrapped in a {hashtag} so they land in the
+// same cluster slot.
+func WithRedisCluster(client *redis.ClusterClient) Option {
+	return func(q *Queue) {
+		q.redis = client
+		q.clustered = true
+	}
+}
+
+// WithRedisFailover runs the queue against a Redis Sentinel deployment,
+// wrapping keys the same way WithRedisCluster does.
+func WithRedisFailover(opts redis.FailoverOptions) Option {
+	return func(q *Queue) {
+		q.redis = redis.NewFailoverClient(&opts)
+		q.clustered = true
+	}
+}
+
+// writeLockKey returns the redsync key used to serialize enqueues of id
+// onto the named subqueue ("" for the default subqueue).
+func (q *Queue) writeLockKey(queue, id string) string {
+	if q.clustered {
+		if queue != defaultSubqueue {
+			return fmt.Sprintf("red:{%s}:w:%s:%s", q.name, queue, id)
+		}
+
+		return fmt.Sprintf("red:{%s}:w:%s", q.name, id)
+	}
+
+	if queue != defaultSubqueue {
+		return fmt.Sprintf("red.w.%s.%s", queue, id)
+	}
+
+	return fmt.Sprintf("red.w.%s", id)
+}
+
+// readLockKey returns the redsync key used to serialize dequeues of id.
+func (q *Queue) readLockKey(id string) string {
+	if q.clustered {
+		return fmt.Sprintf("red:{%s}:r:%s", q.name, id)
+	}
+
+	return fmt.Sprintf("red.r.%s", id)
+}
+
+// schedulerLockKey returns the redsync key used for scheduler exclusivity.
+func (q *Queue) schedulerLockKey() string {
+	if q.clustered {
+		return fmt.Sprintf("red:{%s}:scheduler:w", q.name)
+	}
+
+	return "red.scheduler.w"
+}
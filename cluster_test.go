@@ -0,0 +1,50 @@
+package red
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+var redisClusterAddrs = flag.String("redis_cluster_addrs", "", "comma separated redis cluster addresses to test against")
+
+func TestQueue_ClusterKeys(t *testing.T) {
+	t.Run("uses unclustered keys by default", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, _ := NewQueue("", WithRedis(db), WithConsumers(0), Name("red.test"))
+		assert.Equal(t, "red.w.test", queue.writeLockKey(defaultSubqueue, "test"))
+		assert.Equal(t, "red.r.test", queue.readLockKey("test"))
+		assert.Equal(t, "red.scheduler.w", queue.schedulerLockKey())
+	})
+
+	t.Run("hashtags keys for cluster mode", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, _ := NewQueue("", WithRedis(db), WithConsumers(0), Name("red.test"))
+		queue.clustered = true
+
+		assert.Equal(t, "red:{red.test}:w:test", queue.writeLockKey(defaultSubqueue, "test"))
+		assert.Equal(t, "red:{red.test}:r:test", queue.readLockKey("test"))
+		assert.Equal(t, "red:{red.test}:scheduler:w", queue.schedulerLockKey())
+	})
+}
+
+func TestQueue_Cluster(t *testing.T) {
+	if *redisClusterAddrs == "" {
+		t.Skip("set -redis_cluster_addrs to run against a real redis cluster")
+	}
+
+	addrs := strings.Split(*redisClusterAddrs, ",")
+	client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: addrs})
+	defer client.Close()
+
+	queue, err := NewQueue("", WithRedisCluster(client), WithConsumers(0))
+	assert.Nil(t, err)
+	assert.NotNil(t, queue)
+}
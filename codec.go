@@ -0,0 +1,79 @@
+package red
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pghq/go-tea"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec governs how application values are serialized into and out of a
+// Message's Value.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the default Codec, used unless WithCodec overrides it.
+var JSONCodec Codec = jsonCodec{}
+
+// ProtoCodec marshals values that implement proto.Message as protobuf,
+// for smaller payloads and faster (de)serialization than JSON.
+var ProtoCodec Codec = protoCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, tea.BadRequest("value does not implement proto.Message")
+	}
+
+	return proto.Marshal(msg)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return tea.BadRequest("value does not implement proto.Message")
+	}
+
+	return proto.Unmarshal(data, msg)
+}
+
+// WithCodec overrides the Codec used to (de)serialize enqueued values.
+func WithCodec(codec Codec) Option {
+	return func(q *Queue) {
+		q.codec = codec
+	}
+}
+
+var protoTypes sync.Map // task type name -> func() proto.Message
+
+// RegisterProtoType associates a task type name with a factory for its
+// protobuf message, so consumers can Decode without knowing the concrete
+// type up front.
+func RegisterProtoType(name string, factory func() proto.Message) {
+	protoTypes.Store(name, factory)
+}
+
+// ProtoType looks up the factory registered for a task type name.
+func ProtoType(name string) (func() proto.Message, bool) {
+	v, ok := protoTypes.Load(name)
+	if !ok {
+		return nil, false
+	}
+
+	return v.(func() proto.Message), true
+}
@@ -0,0 +1,69 @@
+package red
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pghq/go-tea"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodec(t *testing.T) {
+	t.Run("json codec round trips", func(t *testing.T) {
+		data, err := JSONCodec.Marshal(map[string]string{"key": "value"})
+		assert.Nil(t, err)
+
+		var value map[string]string
+		err = JSONCodec.Unmarshal(data, &value)
+		assert.Nil(t, err)
+		assert.Equal(t, "value", value["key"])
+	})
+
+	t.Run("proto codec round trips proto messages", func(t *testing.T) {
+		data, err := ProtoCodec.Marshal(wrapperspb.String("value"))
+		assert.Nil(t, err)
+
+		value := &wrapperspb.StringValue{}
+		err = ProtoCodec.Unmarshal(data, value)
+		assert.Nil(t, err)
+		assert.Equal(t, "value", value.GetValue())
+	})
+
+	t.Run("proto codec rejects non proto values", func(t *testing.T) {
+		_, err := ProtoCodec.Marshal("value")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("queue enqueues using the configured codec", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, _ := NewQueue("", WithRedis(db), WithConsumers(0), WithCodec(ProtoCodec))
+
+		err := queue.Enqueue(context.TODO(), "test", wrapperspb.String("value"))
+		assert.Nil(t, err)
+
+		err = queue.Enqueue(context.TODO(), "other", "not a proto message")
+		assert.NotNil(t, err)
+		assert.False(t, tea.IsFatal(err))
+	})
+}
+
+func TestProtoType(t *testing.T) {
+	t.Run("registers and looks up a factory", func(t *testing.T) {
+		RegisterProtoType("test.StringValue", func() proto.Message {
+			return &wrapperspb.StringValue{}
+		})
+
+		factory, ok := ProtoType("test.StringValue")
+		assert.True(t, ok)
+		assert.IsType(t, &wrapperspb.StringValue{}, factory())
+	})
+
+	t.Run("reports unknown types", func(t *testing.T) {
+		_, ok := ProtoType("test.Missing")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,245 @@
+package red
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/adjust/rmq/v4"
+	"github.com/go-redis/redis/v8"
+	"github.com/pghq/go-tea"
+)
+
+// DeadTask is a message whose retry budget has been exhausted.
+type DeadTask struct {
+	Id       string    `json:"id"`
+	Type     string    `json:"type"`
+	Subqueue string    `json:"subqueue,omitempty"`
+	Payload  []byte    `json:"payload"`
+	LastErr  string    `json:"lastErr"`
+	Retried  int       `json:"retried"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// Inspector reads and manages dead lettered tasks.
+type Inspector struct {
+	redis     redis.UniversalClient
+	clustered bool
+}
+
+// InspectorOption configures an Inspector.
+type InspectorOption func(*Inspector)
+
+// Clustered hashtags dead letter keys the same way WithRedisCluster and
+// WithRedisFailover do, for an Inspector pointed at a clustered Queue.
+func Clustered() InspectorOption {
+	return func(i *Inspector) {
+		i.clustered = true
+	}
+}
+
+// NewInspector creates an Inspector backed by db.
+func NewInspector(db redis.UniversalClient, opts ...InspectorOption) *Inspector {
+	i := &Inspector{redis: db}
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
+}
+
+// ListDead returns a page of dead tasks for the named queue, most
+// recently failed first.
+func (i *Inspector) ListDead(ctx context.Context, name string, page, size int) ([]*DeadTask, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	if size < 1 {
+		size = 20
+	}
+
+	start := int64((page - 1) * size)
+	stop := start + int64(size) - 1
+
+	ids, err := i.redis.ZRevRange(ctx, deadSetKey(i.clustered, name), start, stop).Result()
+	if err != nil {
+		return nil, tea.NewError(err)
+	}
+
+	tasks := make([]*DeadTask, 0, len(ids))
+	for _, id := range ids {
+		data, err := i.redis.Get(ctx, deadTaskKey(i.clustered, name, id)).Bytes()
+		if err != nil {
+			continue
+		}
+
+		var task DeadTask
+		if err := json.Unmarshal(data, &task); err != nil {
+			continue
+		}
+
+		tasks = append(tasks, &task)
+	}
+
+	return tasks, nil
+}
+
+// Requeue republishes the dead task with id back onto its original queue.
+func (i *Inspector) Requeue(ctx context.Context, id string) error {
+	name, err := i.redis.Get(ctx, deadIndexKey(id)).Result()
+	if err != nil {
+		return tea.NotFound(err)
+	}
+
+	data, err := i.redis.Get(ctx, deadTaskKey(i.clustered, name, id)).Bytes()
+	if err != nil {
+		return tea.NotFound(err)
+	}
+
+	var task DeadTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return tea.NewError(err)
+	}
+
+	conn, err := rmq.OpenConnectionWithRedisClient(name, i.redis, make(chan error, 1))
+	if err != nil {
+		return tea.NewError(err)
+	}
+
+	queue, err := conn.OpenQueue(subqueueRMQName(name, task.Subqueue))
+	if err != nil {
+		return tea.NewError(err)
+	}
+
+	payload, err := json.Marshal(Message{Id: task.Id, Value: task.Payload})
+	if err != nil {
+		return tea.NewError(err)
+	}
+
+	if err := queue.PublishBytes(payload); err != nil {
+		return tea.NewError(err)
+	}
+
+	return i.DeleteDead(ctx, id)
+}
+
+// DeleteDead removes the dead task with id. The by-id index key lives in
+// its own cluster slot (it isn't scoped to a queue name), so it is deleted
+// outside the by-name pipeline.
+func (i *Inspector) DeleteDead(ctx context.Context, id string) error {
+	name, err := i.redis.Get(ctx, deadIndexKey(id)).Result()
+	if err != nil {
+		return tea.NotFound(err)
+	}
+
+	pipe := i.redis.TxPipeline()
+	pipe.ZRem(ctx, deadSetKey(i.clustered, name), id)
+	pipe.Del(ctx, deadTaskKey(i.clustered, name, id))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return tea.NewError(err)
+	}
+
+	if err := i.redis.Del(ctx, deadIndexKey(id)).Err(); err != nil {
+		return tea.NewError(err)
+	}
+
+	return nil
+}
+
+// DeleteAllDead removes every dead task for the named queue.
+func (i *Inspector) DeleteAllDead(ctx context.Context, name string) error {
+	ids, err := i.redis.ZRange(ctx, deadSetKey(i.clustered, name), 0, -1).Result()
+	if err != nil {
+		return tea.NewError(err)
+	}
+
+	pipe := i.redis.TxPipeline()
+	for _, id := range ids {
+		pipe.Del(ctx, deadTaskKey(i.clustered, name, id))
+	}
+	pipe.Del(ctx, deadSetKey(i.clustered, name))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return tea.NewError(err)
+	}
+
+	for _, id := range ids {
+		if err := i.redis.Del(ctx, deadIndexKey(id)).Err(); err != nil {
+			return tea.NewError(err)
+		}
+	}
+
+	return nil
+}
+
+// deadLetter moves msg into the dead letter for the queue. It does not
+// touch the failed counter; retryOrDeadLetter bumps that on every
+// rejection. The by-id index key is written outside the by-name pipeline
+// since it lives in a different cluster slot.
+func (q *Queue) deadLetter(msg *Message) error {
+	ctx := context.Background()
+	task := DeadTask{
+		Id:       msg.Id,
+		Type:     q.name,
+		Subqueue: msg.subqueue,
+		Payload:  msg.Value,
+		LastErr:  msg.LastErr,
+		Retried:  msg.Retried,
+		FailedAt: time.Now(),
+	}
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return tea.NewError(err)
+	}
+
+	pipe := q.redis.TxPipeline()
+	pipe.Set(ctx, deadTaskKey(q.clustered, q.name, msg.Id), data, 0)
+	pipe.ZAdd(ctx, deadSetKey(q.clustered, q.name), &redis.Z{Score: float64(task.FailedAt.Unix()), Member: msg.Id})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return tea.NewError(err)
+	}
+
+	if err := q.redis.Set(ctx, deadIndexKey(msg.Id), q.name, 0).Err(); err != nil {
+		return tea.NewError(err)
+	}
+
+	return nil
+}
+
+// incrCounter bumps today's daily-bucketed counter of kind ("processed" or
+// "failed") for the queue, for dashboarding.
+func (q *Queue) incrCounter(kind string) {
+	_, _ = q.redis.Incr(context.Background(), counterKey(q.name, kind, time.Now())).Result()
+}
+
+// deadSetKey returns the key for the sorted set of dead task ids for the
+// named queue, hashtagged to colocate with deadTaskKey in cluster mode.
+func deadSetKey(clustered bool, name string) string {
+	if clustered {
+		return fmt.Sprintf("red:{%s}:dead", name)
+	}
+
+	return fmt.Sprintf("red.dead.%s", name)
+}
+
+// deadTaskKey returns the key for the stored dead task data.
+func deadTaskKey(clustered bool, name, id string) string {
+	if clustered {
+		return fmt.Sprintf("red:{%s}:dead:%s", name, id)
+	}
+
+	return fmt.Sprintf("red.dead.%s:%s", name, id)
+}
+
+// deadIndexKey returns the key mapping a dead task id back to its queue
+// name. It is keyed only by id, so it cannot share a hashtag with
+// deadSetKey/deadTaskKey and must always be read/written on its own.
+func deadIndexKey(id string) string {
+	return fmt.Sprintf("red.dead.idx.%s", id)
+}
+
+func counterKey(name, kind string, at time.Time) string {
+	return fmt.Sprintf("red.stats.%s.%s.%s", name, kind, at.Format("20060102"))
+}
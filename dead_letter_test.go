@@ -0,0 +1,62 @@
+package red
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspector(t *testing.T) {
+	t.Run("lists, requeues, and deletes dead tasks", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, _ := NewQueue("", WithRedis(db), WithConsumers(0), MaxRetry(1))
+		inspector := NewInspector(db)
+
+		msg := &Message{Id: "test", Value: []byte(`"value"`)}
+		err := queue.deadLetter(msg)
+		assert.Nil(t, err)
+
+		tasks, err := inspector.ListDead(context.TODO(), queue.name, 1, 10)
+		assert.Nil(t, err)
+		assert.Len(t, tasks, 1)
+		assert.Equal(t, "test", tasks[0].Id)
+
+		err = inspector.Requeue(context.TODO(), "test")
+		assert.Nil(t, err)
+
+		tasks, err = inspector.ListDead(context.TODO(), queue.name, 1, 10)
+		assert.Nil(t, err)
+		assert.Empty(t, tasks)
+	})
+
+	t.Run("deletes all dead tasks for a queue", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, _ := NewQueue("", WithRedis(db), WithConsumers(0), MaxRetry(1))
+		inspector := NewInspector(db)
+
+		_ = queue.deadLetter(&Message{Id: "first"})
+		_ = queue.deadLetter(&Message{Id: "second"})
+
+		err := inspector.DeleteAllDead(context.TODO(), queue.name)
+		assert.Nil(t, err)
+
+		tasks, err := inspector.ListDead(context.TODO(), queue.name, 1, 10)
+		assert.Nil(t, err)
+		assert.Empty(t, tasks)
+	})
+
+	t.Run("raises errors for unknown ids", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		inspector := NewInspector(db)
+
+		err := inspector.DeleteDead(context.TODO(), "missing")
+		assert.NotNil(t, err)
+	})
+}
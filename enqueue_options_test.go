@@ -0,0 +1,51 @@
+package red
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pghq/go-tea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue_EnqueueOptions(t *testing.T) {
+	t.Run("WithUniqueTTL rejects duplicate enqueues", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, _ := NewQueue("", WithRedis(db), WithConsumers(0))
+
+		err := queue.Enqueue(context.TODO(), "test", "value", WithUniqueTTL(time.Minute))
+		assert.Nil(t, err)
+
+		err = queue.Enqueue(context.TODO(), "test", "value", WithUniqueTTL(time.Minute))
+		assert.Equal(t, ErrDuplicateTask, err)
+		assert.False(t, tea.IsFatal(err))
+	})
+
+	t.Run("WithTimeout is restored on dequeue", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, _ := NewQueue("", WithRedis(db), WithConsumers(1))
+
+		err := queue.Enqueue(context.TODO(), "test", "value", WithTimeout(time.Second))
+		assert.Nil(t, err)
+
+		var msg *Message
+		for i := 0; i < 100 && msg == nil; i++ {
+			msg = queue.Message()
+			if msg == nil {
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		assert.NotNil(t, msg)
+		ctx, cancel := msg.Context(context.Background())
+		defer cancel()
+
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+	})
+}
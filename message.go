@@ -0,0 +1,115 @@
+package red
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redsync/redsync/v4"
+	"github.com/pghq/go-tea"
+)
+
+// Message is a unit of work pulled off (or pushed onto) a Queue.
+type Message struct {
+	Id      string `json:"id"`
+	Value   []byte `json:"value"`
+	Retried int    `json:"retried"`
+	LastErr string `json:"lastErr,omitempty"`
+
+	pool     *redsync.Redsync
+	ack      func() error
+	reject   func() error
+	codec    Codec
+	timeout  time.Duration
+	deadline time.Time
+	maxRetry int
+	readKey  string
+	subqueue string
+}
+
+// lockKey returns the redsync key Dequeue locked for this message, or the
+// default, unclustered key if the message was never dequeued.
+func (m *Message) lockKey() string {
+	if m.readKey != "" {
+		return m.readKey
+	}
+
+	return fmt.Sprintf("red.r.%s", m.Id)
+}
+
+// Context wraps parent with this message's configured timeout or
+// deadline, as set by WithTimeout/WithDeadline on Enqueue. Callers should
+// always call the returned cancel function.
+func (m *Message) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	if !m.deadline.IsZero() {
+		return context.WithDeadline(parent, m.deadline)
+	}
+
+	if m.timeout > 0 {
+		return context.WithTimeout(parent, m.timeout)
+	}
+
+	return context.WithCancel(parent)
+}
+
+// Decode unmarshals the message value into v, using the Codec configured
+// on the Queue that produced it, or JSONCodec if none is set.
+func (m Message) Decode(v interface{}) error {
+	codec := m.codec
+	if codec == nil {
+		codec = JSONCodec
+	}
+
+	if err := codec.Unmarshal(m.Value, v); err != nil {
+		return tea.NewError(err)
+	}
+
+	return nil
+}
+
+// Ack acknowledges successful processing of the message, releasing its
+// read lock so the queue can consider it delivered.
+func (m *Message) Ack(_ context.Context) error {
+	if m.ack != nil {
+		if err := m.ack(); err != nil {
+			return tea.NewError(err)
+		}
+	}
+
+	if m.pool != nil {
+		mutex := m.pool.NewMutex(m.lockKey())
+		_, _ = mutex.Unlock()
+	}
+
+	return nil
+}
+
+// Reject marks the message as failed, recording the attempt so the queue
+// can decide whether to retry it or move it to the dead letter. reason,
+// if given, is recorded as LastErr before the queue is told to retry or
+// dead-letter the message, so it is available either way.
+func (m *Message) Reject(_ context.Context, reason ...error) error {
+	if len(reason) > 0 && reason[0] != nil {
+		m.LastErr = reason[0].Error()
+	}
+
+	if m.reject != nil {
+		if err := m.reject(); err != nil {
+			if m.LastErr == "" {
+				m.LastErr = err.Error()
+			}
+			if m.pool != nil {
+				mutex := m.pool.NewMutex(m.lockKey())
+				_, _ = mutex.Unlock()
+			}
+			return tea.NewError(err)
+		}
+	}
+
+	if m.pool != nil {
+		mutex := m.pool.NewMutex(m.lockKey())
+		_, _ = mutex.Unlock()
+	}
+
+	return nil
+}
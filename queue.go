@@ -0,0 +1,647 @@
+// Package red provides a Redis-backed work queue built on top of rmq,
+// with redsync-based locking for exclusive enqueue/dequeue semantics.
+package red
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/adjust/rmq/v4"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redsync/redsync/v4"
+	goredis "github.com/go-redsync/redsync/v4/redis/goredis/v8"
+	"github.com/pghq/go-tea"
+)
+
+// defaultSubqueue is the key under which the unnamed default queue lives
+// in Queue.queues/weights, preserving the pre-priority key layout.
+const defaultSubqueue = ""
+
+// DefaultMaxRetry is the number of times a message may be rejected before
+// it is moved to the dead letter.
+const DefaultMaxRetry = 25
+
+// Queue is a Redis backed work queue.
+type Queue struct {
+	name    string
+	redis   redis.UniversalClient
+	pool    *redsync.Redsync
+	conn    rmq.Connection
+	queues  map[string]rmq.Queue
+	errChan chan error
+
+	consumers int
+	at        time.Duration
+	maxRetry  int
+	weights   map[string]int
+	strict    bool
+	codec     Codec
+	clustered bool
+
+	readOptions  []redsync.Option
+	writeOptions []redsync.Option
+
+	messages   map[string]chan *Message
+	messageCap int
+	errors     chan error
+}
+
+// Option configures a Queue.
+type Option func(*Queue)
+
+// WithRedis uses db as the underlying redis client.
+func WithRedis(db redis.UniversalClient) Option {
+	return func(q *Queue) {
+		q.redis = db
+	}
+}
+
+// WithConsumers sets the number of concurrent rmq consumers.
+func WithConsumers(n int) Option {
+	return func(q *Queue) {
+		q.consumers = n
+	}
+}
+
+// Read appends options used when acquiring a dequeue (read) lock.
+func Read(opts ...redsync.Option) Option {
+	return func(q *Queue) {
+		q.readOptions = append(q.readOptions, opts...)
+	}
+}
+
+// Write appends options used when acquiring an enqueue (write) lock.
+func Write(opts ...redsync.Option) Option {
+	return func(q *Queue) {
+		q.writeOptions = append(q.writeOptions, opts...)
+	}
+}
+
+// Name sets the name of the underlying rmq queue.
+func Name(name string) Option {
+	return func(q *Queue) {
+		q.name = name
+	}
+}
+
+// At sets the polling interval used by rmq consumers.
+func At(d time.Duration) Option {
+	return func(q *Queue) {
+		q.at = d
+	}
+}
+
+// MaxMessages sets the buffer size of each subqueue's in-memory message
+// channel.
+func MaxMessages(n int) Option {
+	return func(q *Queue) {
+		q.messageCap = n
+	}
+}
+
+// MaxErrors sets the buffer size of the in-memory error channel.
+func MaxErrors(n int) Option {
+	return func(q *Queue) {
+		q.errors = make(chan error, n)
+	}
+}
+
+// MaxRetry sets the number of rejections a message tolerates before it is
+// moved to the dead letter.
+func MaxRetry(n int) Option {
+	return func(q *Queue) {
+		q.maxRetry = n
+	}
+}
+
+// WithQueues splits the queue into weighted subqueues, keyed by name, so
+// callers can route work with WithQueue and have higher-weighted
+// subqueues drained more often. Consumers are distributed across
+// subqueues proportional to their weight.
+func WithQueues(weights map[string]int) Option {
+	return func(q *Queue) {
+		q.weights = weights
+	}
+}
+
+// Strict makes the consumer always drain higher-weighted subqueues to
+// completion before a lower-weighted subqueue is touched at all, rather
+// than dequeuing from them proportionally.
+func Strict(strict bool) Option {
+	return func(q *Queue) {
+		q.strict = strict
+	}
+}
+
+// NewQueue creates a new Queue connected to the redis instance at addr,
+// unless an Option supplies a client via WithRedis.
+func NewQueue(addr string, opts ...Option) (*Queue, error) {
+	q := &Queue{
+		name:       "red.messages",
+		consumers:  10,
+		at:         100 * time.Millisecond,
+		maxRetry:   DefaultMaxRetry,
+		codec:      JSONCodec,
+		errChan:    make(chan error, 100),
+		messageCap: 100,
+		errors:     make(chan error, 100),
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	if q.redis == nil {
+		q.redis = redis.NewClient(&redis.Options{Addr: addr})
+	}
+
+	if err := q.redis.Ping(context.Background()).Err(); err != nil {
+		return nil, tea.NewError(err)
+	}
+
+	q.pool = redsync.New(goredis.NewPool(q.redis))
+
+	conn, err := rmq.OpenConnectionWithRedisClient(q.name, q.redis, q.errChan)
+	if err != nil {
+		return nil, tea.NewError(err)
+	}
+	q.conn = conn
+
+	if len(q.weights) == 0 {
+		q.weights = map[string]int{defaultSubqueue: 1}
+	}
+
+	q.queues = map[string]rmq.Queue{}
+	q.messages = map[string]chan *Message{}
+	for name := range q.weights {
+		subQueue, err := conn.OpenQueue(q.subqueueName(name))
+		if err != nil {
+			return nil, tea.NewError(err)
+		}
+		q.queues[name] = subQueue
+		q.messages[name] = make(chan *Message, q.messageCap)
+	}
+
+	if err := q.startConsumers(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// subqueueName returns the underlying rmq queue name for a named
+// subqueue, preserving the unnamed default queue's original name.
+func (q *Queue) subqueueName(name string) string {
+	return subqueueRMQName(q.name, name)
+}
+
+// subqueueRMQName returns the underlying rmq queue name for the named
+// subqueue of the queue identified by base, preserving the unnamed default
+// queue's original name.
+func subqueueRMQName(base, name string) string {
+	if name == defaultSubqueue {
+		return base
+	}
+
+	return fmt.Sprintf("%s.%s", base, name)
+}
+
+// priority orders subqueue names by descending weight, so index 0 is the
+// highest priority subqueue.
+func (q *Queue) priority() []string {
+	names := make([]string, 0, len(q.weights))
+	for name := range q.weights {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if q.weights[names[i]] != q.weights[names[j]] {
+			return q.weights[names[i]] > q.weights[names[j]]
+		}
+
+		return names[i] < names[j]
+	})
+
+	return names
+}
+
+// startConsumers attaches consumers to every subqueue, proportioned by
+// weight. In Strict mode every subqueue gets the full consumer count,
+// since ordering is instead enforced when messages are handed out by
+// Message/Dequeue; see higherDrained.
+func (q *Queue) startConsumers() error {
+	priority := q.priority()
+
+	if q.strict {
+		for _, name := range priority {
+			if err := q.startSubqueue(name, q.consumers); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	total := 0
+	for _, weight := range q.weights {
+		total += weight
+	}
+
+	for _, name := range priority {
+		share := q.consumers
+		if total > 0 {
+			share = q.consumers * q.weights[name] / total
+		}
+
+		if share < 1 && q.consumers > 0 {
+			share = 1
+		}
+
+		if err := q.startSubqueue(name, share); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startSubqueue begins consuming from the named subqueue with share
+// concurrent consumers.
+func (q *Queue) startSubqueue(name string, share int) error {
+	subQueue := q.queues[name]
+
+	if err := subQueue.StartConsuming(int64(share+1), q.at); err != nil {
+		return tea.NewError(err)
+	}
+
+	for i := 0; i < share; i++ {
+		tag := fmt.Sprintf("%s.%d", q.subqueueName(name), i)
+		if _, err := subQueue.AddConsumerFunc(tag, q.consumeFrom(name)); err != nil {
+			return tea.NewError(err)
+		}
+	}
+
+	return nil
+}
+
+// consumeFrom returns a rmq.ConsumerFunc that hands deliveries from the
+// named subqueue to handleDelivery, so a rejected message is republished
+// onto the subqueue it came from.
+func (q *Queue) consumeFrom(name string) rmq.ConsumerFunc {
+	return func(delivery rmq.Delivery) {
+		q.handleDelivery(name, delivery)
+	}
+}
+
+// higherDrained reports whether every subqueue with a higher priority than
+// name has no pending messages, in memory or still sitting in redis. It is
+// re-evaluated on every call, so Strict mode's gate is continuous: a
+// lower-priority subqueue only ever yields a message while nothing
+// higher-priority is outstanding, and pauses again the moment new
+// higher-priority work shows up.
+func (q *Queue) higherDrained(name string) bool {
+	for _, h := range q.priority() {
+		if h == name {
+			return true
+		}
+
+		if len(q.messages[h]) > 0 {
+			return false
+		}
+
+		if n, err := q.queues[h].ReadyCount(); err == nil && n > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Send routes msg onto the in-memory channel for the subqueue it was
+// consumed from, dropping it if that channel is full.
+func (q *Queue) Send(msg *Message) *Queue {
+	ch, ok := q.messages[msg.subqueue]
+	if !ok {
+		ch = q.messages[defaultSubqueue]
+	}
+
+	select {
+	case ch <- msg:
+	default:
+	}
+
+	return q
+}
+
+// Message pops the next available message, or nil if none are available.
+// In Strict mode a subqueue is only considered once every higher-priority
+// subqueue is drained, per higherDrained, so the highest-priority
+// non-empty subqueue always wins. Otherwise, subqueues are picked from at
+// random, weighted by their configured share, so a low-weight subqueue
+// still gets a proportional slice of hand-outs instead of being starved
+// whenever a higher-weight subqueue has buffered work.
+func (q *Queue) Message() *Message {
+	if q.strict {
+		for _, name := range q.priority() {
+			if !q.higherDrained(name) {
+				continue
+			}
+
+			if msg := q.tryRecv(name); msg != nil {
+				return msg
+			}
+		}
+
+		return nil
+	}
+
+	for {
+		name, ok := q.weightedPick()
+		if !ok {
+			return nil
+		}
+
+		if msg := q.tryRecv(name); msg != nil {
+			return msg
+		}
+	}
+}
+
+// tryRecv pops a message off the named subqueue channel without blocking,
+// or nil if it is empty.
+func (q *Queue) tryRecv(name string) *Message {
+	select {
+	case msg := <-q.messages[name]:
+		return msg
+	default:
+		return nil
+	}
+}
+
+// weightedPick randomly selects a non-empty subqueue, weighted by its
+// configured share, for non-strict dequeuing.
+func (q *Queue) weightedPick() (string, bool) {
+	names := make([]string, 0, len(q.weights))
+	total := 0
+	for _, name := range q.priority() {
+		weight := q.weights[name]
+		if weight <= 0 || len(q.messages[name]) == 0 {
+			continue
+		}
+
+		names = append(names, name)
+		total += weight
+	}
+
+	if total == 0 {
+		return "", false
+	}
+
+	pick := rand.Intn(total)
+	for _, name := range names {
+		weight := q.weights[name]
+		if pick < weight {
+			return name, true
+		}
+
+		pick -= weight
+	}
+
+	return "", false
+}
+
+// SendError pushes an error onto the in-memory error channel, dropping it
+// if the channel is full.
+func (q *Queue) SendError(err error) *Queue {
+	select {
+	case q.errors <- err:
+	default:
+	}
+
+	return q
+}
+
+// Error pops an error off the in-memory error channel, or nil if none are
+// available.
+func (q *Queue) Error() error {
+	select {
+	case err := <-q.errors:
+		return err
+	default:
+		return nil
+	}
+}
+
+// consume decodes an rmq delivery into a Message and makes it available to
+// the queue, or reports a decode error.
+func (q *Queue) consume(delivery rmq.Delivery) {
+	q.handleDelivery(defaultSubqueue, delivery)
+}
+
+// handleDelivery decodes an rmq delivery pulled off the named subqueue into
+// a Message and makes it available to the queue, or reports a decode
+// error.
+func (q *Queue) handleDelivery(subqueue string, delivery rmq.Delivery) {
+	var msg Message
+	if err := json.Unmarshal([]byte(delivery.Payload()), &msg); err != nil {
+		// The envelope itself is unreadable, so there is no message to
+		// retry or dead-letter; just report it and leave the delivery for
+		// rmq's own unacked-timeout redelivery rather than rejecting it
+		// here, since some rmq.Delivery implementations (and test mocks)
+		// don't support Reject.
+		q.SendError(tea.NewError(err))
+		return
+	}
+
+	msg.codec = q.codec
+	msg.subqueue = subqueue
+	q.loadTaskOptions(&msg)
+
+	msg.ack = func() error {
+		if err := delivery.Ack(); err != nil {
+			return err
+		}
+
+		q.deleteTaskOptions(context.Background(), msg.Id)
+		q.incrCounter("processed")
+		return nil
+	}
+	msg.reject = func() error {
+		return q.retryOrDeadLetter(subqueue, delivery, &msg)
+	}
+
+	q.Send(&msg)
+}
+
+// retryOrDeadLetter is called when a dequeued message is rejected. It
+// republishes the message onto the subqueue it came from with its retry
+// count incremented, or moves it to the dead letter once maxRetry is
+// exhausted. Since rmq's delivery.Reject does not redeliver a message for
+// reconsumption, retries are driven by this manual republish instead: the
+// original delivery is always acked, and a fresh delivery carrying the
+// incremented Retried/LastErr takes its place when retries remain.
+func (q *Queue) retryOrDeadLetter(subqueue string, delivery rmq.Delivery, msg *Message) error {
+	q.incrCounter("failed")
+
+	maxRetry := q.maxRetry
+	if msg.maxRetry > 0 {
+		maxRetry = msg.maxRetry
+	}
+
+	retried := msg.Retried + 1
+	if retried >= maxRetry {
+		msg.Retried = retried
+		if err := q.deadLetter(msg); err != nil {
+			return err
+		}
+
+		q.deleteTaskOptions(context.Background(), msg.Id)
+		return delivery.Ack()
+	}
+
+	payload, err := json.Marshal(Message{Id: msg.Id, Value: msg.Value, Retried: retried, LastErr: msg.LastErr})
+	if err != nil {
+		return tea.NewError(err)
+	}
+
+	subQueue, ok := q.queues[subqueue]
+	if !ok {
+		subQueue = q.queues[defaultSubqueue]
+	}
+
+	if err := subQueue.PublishBytes(payload); err != nil {
+		return tea.NewError(err)
+	}
+
+	return delivery.Ack()
+}
+
+// EnqueueOption configures a single Enqueue call.
+type EnqueueOption func(*enqueueConfig)
+
+type enqueueConfig struct {
+	queue     string
+	timeout   time.Duration
+	deadline  time.Time
+	maxRetry  int
+	uniqueTTL time.Duration
+}
+
+// WithQueue routes the enqueued message to the named subqueue configured
+// via WithQueues, instead of the default queue.
+func WithQueue(name string) EnqueueOption {
+	return func(c *enqueueConfig) {
+		c.queue = name
+	}
+}
+
+// WithTimeout bounds how long a handler may spend processing the task,
+// starting once it is dequeued. See Message.Context.
+func WithTimeout(d time.Duration) EnqueueOption {
+	return func(c *enqueueConfig) {
+		c.timeout = d
+	}
+}
+
+// WithDeadline bounds the absolute time by which a handler must finish
+// processing the task. See Message.Context.
+func WithDeadline(t time.Time) EnqueueOption {
+	return func(c *enqueueConfig) {
+		c.deadline = t
+	}
+}
+
+// WithMaxRetry overrides the queue's default MaxRetry for this task.
+func WithMaxRetry(n int) EnqueueOption {
+	return func(c *enqueueConfig) {
+		c.maxRetry = n
+	}
+}
+
+// WithUniqueTTL rejects the enqueue with ErrDuplicateTask if an equivalent
+// task (same queue, id, and value) was already enqueued within d.
+func WithUniqueTTL(d time.Duration) EnqueueOption {
+	return func(c *enqueueConfig) {
+		c.uniqueTTL = d
+	}
+}
+
+// Enqueue publishes value under id, guarding against concurrent enqueues
+// of the same id with a redsync write lock.
+func (q *Queue) Enqueue(ctx context.Context, id string, value interface{}, opts ...EnqueueOption) error {
+	cfg := enqueueConfig{queue: defaultSubqueue}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	subQueue, ok := q.queues[cfg.queue]
+	if !ok {
+		return tea.BadRequest(fmt.Sprintf("unknown queue %q", cfg.queue))
+	}
+
+	data, err := q.codec.Marshal(value)
+	if err != nil {
+		return tea.BadRequest(err)
+	}
+
+	if cfg.uniqueTTL > 0 {
+		unique, err := q.claimUnique(ctx, cfg.queue, id, data, cfg.uniqueTTL)
+		if err != nil {
+			return err
+		}
+
+		if !unique {
+			return ErrDuplicateTask
+		}
+	}
+
+	mutex := q.pool.NewMutex(q.writeLockKey(cfg.queue, id), q.writeOptions...)
+	if err := mutex.LockContext(ctx); err != nil {
+		return tea.BadRequest(err)
+	}
+	defer mutex.Unlock()
+
+	if err := q.storeTaskOptions(ctx, id, cfg); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(Message{Id: id, Value: data})
+	if err != nil {
+		return tea.BadRequest(err)
+	}
+
+	if err := subQueue.PublishBytes(payload); err != nil {
+		return tea.NewError(err)
+	}
+
+	return nil
+}
+
+// Dequeue pops the next available message and acquires its read lock, so
+// that only one consumer processes it at a time.
+func (q *Queue) Dequeue(ctx context.Context) (*Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, tea.NewError(ctx.Err())
+	default:
+	}
+
+	msg := q.Message()
+	if msg == nil {
+		return nil, tea.NotFound("queue is empty")
+	}
+
+	readKey := q.readLockKey(msg.Id)
+	mutex := q.pool.NewMutex(readKey, q.readOptions...)
+	if err := mutex.LockContext(ctx); err != nil {
+		return nil, tea.NewError(err)
+	}
+
+	msg.pool = q.pool
+	msg.readKey = readKey
+	return msg, nil
+}
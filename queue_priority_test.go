@@ -0,0 +1,45 @@
+package red
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue_Priority(t *testing.T) {
+	t.Run("opens a subqueue per weighted name", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, err := NewQueue("", WithRedis(db), WithConsumers(9),
+			WithQueues(map[string]int{"critical": 6, "default": 3}))
+		assert.Nil(t, err)
+		assert.Len(t, queue.queues, 2)
+	})
+
+	t.Run("routes enqueues to the named subqueue", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, _ := NewQueue("", WithRedis(db), WithConsumers(0),
+			WithQueues(map[string]int{"critical": 2, "default": 1}))
+
+		err := queue.Enqueue(context.TODO(), "test", "value", WithQueue("critical"))
+		assert.Nil(t, err)
+
+		n, err := queue.queues["critical"].ReadyCount()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+
+	t.Run("raises errors for unknown subqueues", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, _ := NewQueue("", WithRedis(db), WithConsumers(0))
+
+		err := queue.Enqueue(context.TODO(), "test", "value", WithQueue("missing"))
+		assert.NotNil(t, err)
+	})
+}
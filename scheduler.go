@@ -0,0 +1,301 @@
+package red
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pghq/go-tea"
+)
+
+const (
+	// DefaultSchedulerInterval is how often the Scheduler checks its tasks.
+	DefaultSchedulerInterval = 10 * time.Millisecond
+
+	// DefaultEnqueueTimeout bounds how long a scheduled enqueue may take.
+	DefaultEnqueueTimeout = 5 * time.Second
+
+	// DefaultDequeueTimeout bounds how long a Worker waits for a task.
+	DefaultDequeueTimeout = 5 * time.Second
+)
+
+// Scheduler periodically enqueues due Tasks onto a Queue.
+type Scheduler struct {
+	queue *Queue
+
+	interval       time.Duration
+	enqueueTimeout time.Duration
+	dequeueTimeout time.Duration
+	maxRetries     int
+	quiet          bool
+
+	mu    sync.Mutex
+	tasks map[string]*Task
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewScheduler creates a Scheduler that enqueues onto queue.
+func NewScheduler(queue *Queue) *Scheduler {
+	return &Scheduler{
+		queue:          queue,
+		interval:       DefaultSchedulerInterval,
+		enqueueTimeout: DefaultEnqueueTimeout,
+		dequeueTimeout: DefaultDequeueTimeout,
+		tasks:          map[string]*Task{},
+		stop:           make(chan struct{}),
+	}
+}
+
+// Quiet suppresses error logging.
+func (s *Scheduler) Quiet() *Scheduler {
+	s.quiet = true
+	return s
+}
+
+// Every sets the interval between scheduling passes.
+func (s *Scheduler) Every(d time.Duration) *Scheduler {
+	s.interval = d
+	return s
+}
+
+// EnqueueTimeout sets how long a scheduled enqueue may take.
+func (s *Scheduler) EnqueueTimeout(d time.Duration) *Scheduler {
+	s.enqueueTimeout = d
+	return s
+}
+
+// DequeueTimeout sets how long a Worker waits for a task.
+func (s *Scheduler) DequeueTimeout(d time.Duration) *Scheduler {
+	s.dequeueTimeout = d
+	return s
+}
+
+// MaxRetries sets how many times the scheduler retries obtaining
+// exclusivity before giving up on a Start call.
+func (s *Scheduler) MaxRetries(n int) *Scheduler {
+	s.maxRetries = n
+	return s
+}
+
+// Add registers task with the scheduler, ignoring tasks without an id and
+// tasks that have already been added.
+func (s *Scheduler) Add(task *Task) *Scheduler {
+	if task.Id == "" {
+		return s
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tasks[task.Id]; ok {
+		return s
+	}
+
+	task.Schedule.LastRun = s.loadLastRun(task.Id)
+	s.tasks[task.Id] = task
+	return s
+}
+
+// Start runs the scheduling loop until Stop is called. Only one scheduler
+// process may run at a time; Start blocks waiting for exclusivity.
+func (s *Scheduler) Start() {
+	mutex := s.queue.pool.NewMutex(s.queue.schedulerLockKey())
+
+	tries := s.maxRetries
+	if tries <= 0 {
+		tries = 1
+	}
+
+	var err error
+	for i := 0; i < tries; i++ {
+		if err = mutex.Lock(); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		if !s.quiet {
+			s.queue.SendError(tea.NewError(err))
+		}
+		return
+	}
+	defer mutex.Unlock()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.tick(now)
+		}
+	}
+}
+
+func (s *Scheduler) tick(now time.Time) {
+	s.mu.Lock()
+	tasks := make([]*Task, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	s.mu.Unlock()
+
+	for _, task := range tasks {
+		if !task.Schedule.LastRun.IsZero() && now.Sub(task.Schedule.LastRun) < s.interval {
+			continue
+		}
+
+		if !task.CanSchedule(now) {
+			continue
+		}
+
+		if task.jitter > 0 {
+			go s.enqueue(task, time.Duration(rand.Int63n(int64(task.jitter))))
+		} else {
+			s.enqueue(task, 0)
+		}
+	}
+}
+
+// enqueue publishes task, waiting delay first (for jitter), and records
+// the attempt.
+func (s *Scheduler) enqueue(task *Task, delay time.Duration) {
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.enqueueTimeout)
+	err := s.queue.Enqueue(ctx, task.Id, task)
+	cancel()
+
+	if err != nil {
+		if !s.quiet {
+			s.queue.SendError(tea.NewError(err))
+		}
+	} else {
+		task.Schedule.Count++
+		task.Schedule.LastRun = time.Now()
+		s.storeLastRun(task.Id, task.Schedule.LastRun)
+	}
+
+	task.Unlock()
+}
+
+// SchedulerEntry is a snapshot of a registered task, for observability.
+type SchedulerEntry struct {
+	TaskId      string
+	NextRun     time.Time
+	LastRun     time.Time
+	Occurrences int
+}
+
+// Entries returns a snapshot of every registered task.
+func (s *Scheduler) Entries() []SchedulerEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]SchedulerEntry, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		var nextRun time.Time
+		if next := task.Next(time.Now(), 1); len(next) > 0 {
+			nextRun = next[0]
+		}
+
+		entries = append(entries, SchedulerEntry{
+			TaskId:      task.Id,
+			NextRun:     nextRun,
+			LastRun:     task.Schedule.LastRun,
+			Occurrences: task.Occurrences(),
+		})
+	}
+
+	return entries
+}
+
+func lastRunKey(name, id string) string {
+	return fmt.Sprintf("red:{%s}:lastrun:%s", name, id)
+}
+
+func (s *Scheduler) loadLastRun(id string) time.Time {
+	v, err := s.queue.redis.Get(context.Background(), lastRunKey(s.queue.name, id)).Result()
+	if err != nil {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+func (s *Scheduler) storeLastRun(id string, at time.Time) {
+	_ = s.queue.redis.Set(context.Background(), lastRunKey(s.queue.name, id), at.Format(time.RFC3339Nano), 0).Err()
+}
+
+// Stop halts the scheduling loop. It is safe to call more than once.
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// Worker dequeues tasks enqueued by a Scheduler and passes them to fn.
+type Worker struct {
+	scheduler *Scheduler
+	fn        func(*Task)
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Worker creates a Worker that processes tasks with fn.
+func (s *Scheduler) Worker(fn func(*Task)) *Worker {
+	return &Worker{
+		scheduler: s,
+		fn:        fn,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start runs the worker loop until Stop is called.
+func (w *Worker) Start() {
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), w.scheduler.dequeueTimeout)
+		msg, err := w.scheduler.queue.Dequeue(ctx)
+		cancel()
+
+		if err != nil {
+			continue
+		}
+
+		var task Task
+		if err := msg.Decode(&task); err != nil {
+			_ = msg.Reject(context.Background())
+			continue
+		}
+
+		w.fn(&task)
+		_ = msg.Ack(context.Background())
+	}
+}
+
+// Stop halts the worker loop. It is safe to call more than once.
+func (w *Worker) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
@@ -0,0 +1,61 @@
+package red
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTask_Next(t *testing.T) {
+	t.Run("one shot tasks have a single upcoming occurrence", func(t *testing.T) {
+		task := NewTask("test")
+		now := time.Now()
+		next := task.Next(now, 5)
+		assert.Equal(t, []time.Time{now}, next)
+	})
+
+	t.Run("completed one shot tasks have no occurrences", func(t *testing.T) {
+		task := NewTask("test")
+		task.Schedule.Count = 1
+		assert.Empty(t, task.Next(time.Now(), 5))
+	})
+
+	t.Run("recurring tasks return up to n occurrences", func(t *testing.T) {
+		task := NewTask("test")
+		_ = task.SetRecurrence("FREQ=DAILY")
+		next := task.Next(time.Now(), 3)
+		assert.Len(t, next, 3)
+		assert.True(t, next[0].Before(next[1]))
+		assert.True(t, next[1].Before(next[2]))
+	})
+
+	t.Run("bad recurrence has no occurrences", func(t *testing.T) {
+		task := NewTask("test")
+		task.Schedule.Recurrence = "DAILY"
+		assert.Empty(t, task.Next(time.Now(), 5))
+	})
+}
+
+func TestScheduler_Entries(t *testing.T) {
+	t.Run("snapshots registered tasks", func(t *testing.T) {
+		db, teardown := setup(t)
+		defer teardown()
+
+		queue, _ := NewQueue("", WithRedis(db), WithConsumers(0))
+		task := NewTask("test")
+		s := NewScheduler(queue).Add(task)
+
+		entries := s.Entries()
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "test", entries[0].TaskId)
+		assert.Equal(t, 0, entries[0].Occurrences)
+	})
+}
+
+func TestTask_WithJitter(t *testing.T) {
+	t.Run("can set a jitter window", func(t *testing.T) {
+		task := NewTask("test").WithJitter(time.Second)
+		assert.Equal(t, time.Second, task.jitter)
+	})
+}
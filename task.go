@@ -0,0 +1,165 @@
+package red
+
+import (
+	"time"
+
+	"github.com/pghq/go-tea"
+	"github.com/teambition/rrule-go"
+)
+
+// rruleOptions parses an RRULE string into its component options.
+func rruleOptions(recurrence string) (*rrule.ROption, error) {
+	return rrule.StrToROption(recurrence)
+}
+
+// Schedule holds the recurrence state for a Task.
+type Schedule struct {
+	Recurrence string
+	Count      int
+	LastRun    time.Time
+}
+
+// Task is a unit of recurring work managed by a Scheduler. With no
+// Recurrence set a Task runs exactly once, as soon as the scheduler sees
+// it.
+type Task struct {
+	Id       string
+	Schedule Schedule
+
+	lock   chan struct{}
+	jitter time.Duration
+}
+
+// NewTask creates a new Task identified by id.
+func NewTask(id string) *Task {
+	return &Task{
+		Id:   id,
+		lock: make(chan struct{}, 1),
+	}
+}
+
+// WithJitter spreads the task's occurrences by a uniform random offset in
+// [0,max), so recurring tasks that align on the same tick across many
+// scheduler nodes don't all enqueue at once.
+func (t *Task) WithJitter(max time.Duration) *Task {
+	t.jitter = max
+	return t
+}
+
+// SetRecurrence sets the task's RRULE recurrence string, rejecting it if
+// it cannot be parsed.
+func (t *Task) SetRecurrence(recurrence string) error {
+	if _, err := rruleOptions(recurrence); err != nil {
+		return tea.NewError(err)
+	}
+
+	t.Schedule.Recurrence = recurrence
+	return nil
+}
+
+// Occurrences returns the number of times the task has been scheduled.
+func (t *Task) Occurrences() int {
+	return t.Schedule.Count
+}
+
+// CanSchedule reports whether the task is due to run at now, claiming an
+// exclusive scheduling slot if so. Callers must call Unlock once they are
+// done acting on the result.
+func (t *Task) CanSchedule(now time.Time) bool {
+	if t.IsComplete() {
+		return false
+	}
+
+	if t.Schedule.Recurrence != "" {
+		opt, err := rruleOptions(t.Schedule.Recurrence)
+		if err != nil {
+			return false
+		}
+
+		if !opt.Dtstart.IsZero() && opt.Dtstart.After(now) {
+			return false
+		}
+	}
+
+	select {
+	case t.lock <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsComplete reports whether the task has exhausted its recurrence.
+func (t *Task) IsComplete() bool {
+	if t.Schedule.Recurrence == "" {
+		return t.Schedule.Count >= 1
+	}
+
+	opt, err := rruleOptions(t.Schedule.Recurrence)
+	if err != nil {
+		return true
+	}
+
+	if !opt.Until.IsZero() && opt.Until.Before(time.Now()) {
+		return true
+	}
+
+	if opt.Count > 0 && t.Schedule.Count >= opt.Count {
+		return true
+	}
+
+	return false
+}
+
+// Next returns up to n occurrences of the task's recurrence at or after
+// after, for observability. A task with no recurrence has at most one
+// occurrence: after itself, if it hasn't already run.
+func (t *Task) Next(after time.Time, n int) []time.Time {
+	if n <= 0 {
+		return nil
+	}
+
+	if t.Schedule.Recurrence == "" {
+		if t.IsComplete() {
+			return nil
+		}
+
+		return []time.Time{after}
+	}
+
+	opt, err := rruleOptions(t.Schedule.Recurrence)
+	if err != nil {
+		return nil
+	}
+
+	rule, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return nil
+	}
+
+	next := rule.Iterator()
+	occurrences := make([]time.Time, 0, n)
+	for len(occurrences) < n {
+		dt, ok := next()
+		if !ok {
+			break
+		}
+
+		if dt.Before(after) {
+			continue
+		}
+
+		occurrences = append(occurrences, dt)
+	}
+
+	return occurrences
+}
+
+// Unlock releases the exclusive scheduling slot claimed by CanSchedule. It
+// is safe to call even if no slot is held.
+func (t *Task) Unlock() {
+	select {
+	case <-t.lock:
+	default:
+	}
+}
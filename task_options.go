@@ -0,0 +1,112 @@
+package red
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pghq/go-tea"
+)
+
+// ErrDuplicateTask is returned by Enqueue when WithUniqueTTL rejects a
+// duplicate enqueue. It is non-fatal.
+var ErrDuplicateTask = tea.BadRequest("duplicate task")
+
+// taskKey is the per-task hash holding a queued task's enqueue options,
+// hashtagged by queue name so it shares a redis cluster slot with the
+// queue's other hashtagged keys. The unique key from uniqueKey carries no
+// hashtag and may land in a different slot.
+func taskKey(name, id string) string {
+	return fmt.Sprintf("red:{%s}:t:%s", name, id)
+}
+
+func uniqueKey(queue, id string, data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(queue))
+	h.Write([]byte(id))
+	h.Write(data)
+	return fmt.Sprintf("red:unique:%x", h.Sum(nil))
+}
+
+// claimUnique reports whether this enqueue is the first seen for
+// queue+id+data within ttl, claiming it if so.
+func (q *Queue) claimUnique(ctx context.Context, queue, id string, data []byte, ttl time.Duration) (bool, error) {
+	ok, err := q.redis.SetNX(ctx, uniqueKey(queue, id, data), 1, ttl).Result()
+	if err != nil {
+		return false, tea.NewError(err)
+	}
+
+	return ok, nil
+}
+
+// storeTaskOptions persists the per-task timeout/deadline/maxRetry chosen
+// at enqueue time, so the consumer can rebuild them on dequeue. The hash is
+// always cleared first, so re-enqueuing id with fewer (or no) options
+// doesn't inherit stale fields from a prior enqueue.
+func (q *Queue) storeTaskOptions(ctx context.Context, id string, cfg enqueueConfig) error {
+	fields := map[string]interface{}{}
+	if cfg.timeout > 0 {
+		fields["timeout"] = cfg.timeout.String()
+	}
+
+	if !cfg.deadline.IsZero() {
+		fields["deadline"] = cfg.deadline.Format(time.RFC3339Nano)
+	}
+
+	if cfg.maxRetry > 0 {
+		fields["maxRetry"] = cfg.maxRetry
+	}
+
+	key := taskKey(q.name, id)
+	if len(fields) == 0 {
+		if err := q.redis.Del(ctx, key).Err(); err != nil {
+			return tea.NewError(err)
+		}
+
+		return nil
+	}
+
+	pipe := q.redis.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, fields)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return tea.NewError(err)
+	}
+
+	return nil
+}
+
+// deleteTaskOptions removes the per-task options hash for id, once it has
+// been acked or dead-lettered and will never be dequeued again.
+func (q *Queue) deleteTaskOptions(ctx context.Context, id string) {
+	_ = q.redis.Del(ctx, taskKey(q.name, id)).Err()
+}
+
+// loadTaskOptions reads back options stored by storeTaskOptions and
+// applies them to msg.
+func (q *Queue) loadTaskOptions(msg *Message) {
+	fields, err := q.redis.HGetAll(context.Background(), taskKey(q.name, msg.Id)).Result()
+	if err != nil || len(fields) == 0 {
+		return
+	}
+
+	if v, ok := fields["timeout"]; ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			msg.timeout = d
+		}
+	}
+
+	if v, ok := fields["deadline"]; ok {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			msg.deadline = t
+		}
+	}
+
+	if v, ok := fields["maxRetry"]; ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			msg.maxRetry = n
+		}
+	}
+}